@@ -0,0 +1,100 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import "testing"
+
+func TestHandleValScalarArray(t *testing.T) {
+	flatM := make(map[string]interface{})
+	handleVal("", "InsecureSecrets", []interface{}{"a", "b", "c"}, flatM)
+
+	if got, want := flatM["InsecureSecrets"], "a,b,c"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestHandleValInt64AndInt(t *testing.T) {
+	// go-toml and yaml.v3 decode integer scalars as int64/int rather than
+	// the float64 encoding/json produces; pin down the flattened string so
+	// this doesn't regress silently again.
+	cases := []struct {
+		name string
+		v    interface{}
+	}{
+		{"int64", int64(8080)},
+		{"int", int(8080)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			flatM := make(map[string]interface{})
+			handleVal("", "Port", c.v, flatM)
+
+			if got, want := flatM["Port"], "8080"; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestHandleValObjectArraySkipped(t *testing.T) {
+	flatM := make(map[string]interface{})
+	handleVal("Clients", "List", []interface{}{map[string]interface{}{"Host": "localhost"}}, flatM)
+
+	if len(flatM) != 0 {
+		t.Errorf("expected no keys for an array of objects, got %v", flatM)
+	}
+}
+
+func TestUnmarshalEnvFormats(t *testing.T) {
+	cases := []struct {
+		name   string
+		format string
+		env    string
+	}{
+		{"json default", "", `{"Service":{"Port":8080}}`},
+		{"json explicit", "json", `{"Service":{"Port":8080}}`},
+		{"toml", "toml", "[Service]\nPort = 8080\n"},
+		{"yaml", "yaml", "Service:\n  Port: 8080\n"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m, err := unmarshalEnv(c.env, c.format)
+			if err != nil {
+				t.Fatalf("unmarshalEnv(%q) returned error: %v", c.format, err)
+			}
+
+			svc, ok := m["Service"].(map[string]interface{})
+			if !ok {
+				t.Fatalf("expected Service to be a map, got %T", m["Service"])
+			}
+			if _, ok := svc["Port"]; !ok {
+				t.Fatalf("expected Service.Port to be present, got %v", svc)
+			}
+		})
+	}
+}
+
+func TestUnmarshalEnvUnsupportedFormat(t *testing.T) {
+	if _, err := unmarshalEnv("{}", "xml"); err == nil {
+		t.Fatal("expected an error for an unsupported format")
+	}
+}
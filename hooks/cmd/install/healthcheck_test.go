@@ -0,0 +1,179 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// withFastHealthCheck shortens healthCheckRetries/healthCheckDelay for the
+// duration of a test so retry paths don't make the suite slow.
+func withFastHealthCheck(t *testing.T, retries int) {
+	origRetries, origDelay := healthCheckRetries, healthCheckDelay
+	healthCheckRetries = retries
+	healthCheckDelay = time.Millisecond
+	t.Cleanup(func() {
+		healthCheckRetries = origRetries
+		healthCheckDelay = origDelay
+	})
+}
+
+func hostPort(t *testing.T, srv *httptest.Server) (string, int) {
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("couldn't parse test server URL %q: %v", srv.URL, err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatalf("couldn't parse test server port from %q: %v", srv.URL, err)
+	}
+	return u.Hostname(), port
+}
+
+func TestPingServiceSucceedsImmediately(t *testing.T) {
+	withFastHealthCheck(t, 3)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	host, port := hostPort(t, srv)
+	if err := pingService(host, port); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPingServiceSucceedsAfterRetries(t *testing.T) {
+	withFastHealthCheck(t, 3)
+
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	host, port := hostPort(t, srv)
+	if err := pingService(host, port); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPingServiceFailsAfterRetriesExhausted(t *testing.T) {
+	withFastHealthCheck(t, 2)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	host, port := hostPort(t, srv)
+	if err := pingService(host, port); err == nil {
+		t.Fatal("expected an error once retries are exhausted")
+	}
+}
+
+func configHandler(config map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"config": config})
+	}
+}
+
+func TestVerifyConfigMatches(t *testing.T) {
+	withFastHealthCheck(t, 3)
+
+	srv := httptest.NewServer(configHandler(map[string]interface{}{
+		"Service": map[string]interface{}{"Host": "localhost"},
+	}))
+	defer srv.Close()
+
+	host, port := hostPort(t, srv)
+	written := map[string]string{"Service.Host": "localhost"}
+	if err := verifyConfig(host, port, written); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestVerifyConfigRetriesUntilMatch(t *testing.T) {
+	withFastHealthCheck(t, 3)
+
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 2 {
+			// the service is up but hasn't reloaded its config yet
+			configHandler(map[string]interface{}{
+				"Service": map[string]interface{}{"Host": "stale"},
+			})(w, r)
+			return
+		}
+		configHandler(map[string]interface{}{
+			"Service": map[string]interface{}{"Host": "localhost"},
+		})(w, r)
+	}))
+	defer srv.Close()
+
+	host, port := hostPort(t, srv)
+	written := map[string]string{"Service.Host": "localhost"}
+	if err := verifyConfig(host, port, written); err != nil {
+		t.Errorf("expected verifyConfig to succeed once the config catches up: %v", err)
+	}
+}
+
+func TestVerifyConfigFailsOnMismatchAfterRetriesExhausted(t *testing.T) {
+	withFastHealthCheck(t, 2)
+
+	srv := httptest.NewServer(configHandler(map[string]interface{}{
+		"Service": map[string]interface{}{"Host": "wrong-host"},
+	}))
+	defer srv.Close()
+
+	host, port := hostPort(t, srv)
+	written := map[string]string{"Service.Host": "localhost"}
+	if err := verifyConfig(host, port, written); err == nil {
+		t.Fatal("expected an error for a mismatched config value")
+	}
+}
+
+func TestVerifyConfigFailsOnMissingKey(t *testing.T) {
+	withFastHealthCheck(t, 2)
+
+	srv := httptest.NewServer(configHandler(map[string]interface{}{
+		"Writable": map[string]interface{}{"LogLevel": "INFO"},
+	}))
+	defer srv.Close()
+
+	host, port := hostPort(t, srv)
+	written := map[string]string{"Service.Host": "localhost"}
+	if err := verifyConfig(host, port, written); err == nil {
+		t.Fatal("expected an error for a key missing from the running config")
+	}
+}
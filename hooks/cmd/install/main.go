@@ -23,12 +23,27 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/syslog"
+	"net/http"
 	"os"
 	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/edgex-go/app-service-configurable/hooks"
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
+)
+
+// healthCheckRetries and healthCheckDelay bound how long we wait for the
+// restarted service to come back up, and for its config to reload, before
+// declaring the new config a failure. Variables rather than constants so
+// tests can shorten them.
+var (
+	healthCheckRetries = 5
+	healthCheckDelay   = 2 * time.Second
 )
 
 var log syslog.Writer
@@ -142,57 +157,442 @@ func handleVal(p string, k string, v interface{}, flatM map[string]interface{})
 	case float64:
 		log.Info(fmt.Sprintf("ADDING %s=%v to flatM", k, t))
 		flatM[mk] = strconv.FormatFloat(t, 'f', -1, 64)
+	case int64:
+		// go-toml and yaml.v3 decode integer scalars as int64/int rather
+		// than the float64 encoding/json produces.
+		log.Info(fmt.Sprintf("ADDING %s=%v to flatM", k, t))
+		flatM[mk] = strconv.FormatInt(t, 10)
+	case int:
+		log.Info(fmt.Sprintf("ADDING %s=%v to flatM", k, t))
+		flatM[mk] = strconv.Itoa(t)
 	case map[string]interface{}:
 		log.Info(fmt.Sprintf("FOUND AN OBJECT"))
 
 		for k, v := range t {
 			handleVal(mk, k, v, flatM)
 		}
+	case []interface{}:
+		log.Info(fmt.Sprintf("FOUND AN ARRAY"))
+
+		// arrays of scalars (e.g. Writable.InsecureSecrets, device/client
+		// lists) flatten to a single comma-separated value under the
+		// parent key. Arrays containing objects have no single
+		// hooks.ConfToEnv entry to validate against, so they aren't
+		// supported - only scalar arrays are.
+		parts := make([]string, 0, len(t))
+		allScalar := true
+		for _, e := range t {
+			switch s := e.(type) {
+			case string:
+				parts = append(parts, s)
+			case bool:
+				parts = append(parts, strconv.FormatBool(s))
+			case float64:
+				parts = append(parts, strconv.FormatFloat(s, 'f', -1, 64))
+			case int64:
+				parts = append(parts, strconv.FormatInt(s, 10))
+			case int:
+				parts = append(parts, strconv.Itoa(s))
+			default:
+				allScalar = false
+			}
+		}
+
+		if allScalar {
+			log.Info(fmt.Sprintf("ADDING %s=%s to flatM", mk, strings.Join(parts, ",")))
+			flatM[mk] = strings.Join(parts, ",")
+		} else {
+			log.Err(fmt.Sprintf("%s is an array of objects; only scalar arrays are supported", mk))
+		}
 	default:
 		log.Err("I DON'T KNOW!!!!")
 	}
 }
 
-func handleSvcConf(env string) {
-	log.Info(fmt.Sprintf("edgex-asc:configure:handleSvcConf config is %s", env))
+// unmarshalEnv parses env according to format ("json", "toml", or "yaml")
+// into a generic map suitable for handleVal's flattening pass. format
+// defaults to "json" when empty, matching the historical behavior of
+// handleSvcConf.
+func unmarshalEnv(env string, format string) (map[string]interface{}, error) {
+	var m map[string]interface{}
 
-	if env == "" {
-		return
+	switch format {
+	case "toml":
+		tree, err := toml.Load(env)
+		if err != nil {
+			return nil, err
+		}
+		m = tree.ToMap()
+	case "yaml":
+		if err := yaml.Unmarshal([]byte(env), &m); err != nil {
+			return nil, err
+		}
+	case "", "json":
+		if err := json.Unmarshal([]byte(env), &m); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format %q; expected json, toml, or yaml", format)
 	}
 
-	var m map[string]interface{}
-	var flatM map[string]interface{}
-	flatM = make(map[string]interface{})
+	return m, nil
+}
+
+// checkType reports whether val - already flattened to its string form by
+// handleVal - is a valid representation of expected, one of the
+// ConfSpec.Type values.
+func checkType(val string, expected string) bool {
+	switch expected {
+	case "string", "[]string":
+		return true
+	case "bool":
+		return val == "true" || val == "false"
+	case "int":
+		_, err := strconv.Atoi(val)
+		return err == nil
+	case "float":
+		_, err := strconv.ParseFloat(val, 64)
+		return err == nil
+	case "duration":
+		_, err := time.ParseDuration(val)
+		return err == nil
+	default:
+		return false
+	}
+}
+
+// confSection returns the top-level "Section" of a flattened "Section.Key"
+// configuration path.
+func confSection(key string) string {
+	return strings.SplitN(key, ".", 2)[0]
+}
+
+// validateFlatM rejects any flattened key that isn't declared in
+// hooks.ConfToEnv, any value that doesn't match that key's declared
+// ConfSpec.Type, and any missing key whose ConfSpec.Required is set - but
+// only within sections the caller actually touched. A snap set that only
+// pastes a `[Writable]` block, say, isn't required to also repeat
+// Service.Host/Service.Port; one that touches Service at all must set
+// every required key in that section.
+func validateFlatM(flatM map[string]interface{}) error {
+	touchedSections := make(map[string]bool, len(flatM))
+
+	for k, v := range flatM {
+		spec, ok := hooks.ConfToEnv[k]
+		if !ok {
+			return fmt.Errorf("edgex-asc:configure:validate: %q is not a recognized configuration key", k)
+		}
+
+		val, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("edgex-asc:configure:validate: %q has unexpected value %v", k, v)
+		}
+		if !checkType(val, spec.Type) {
+			return fmt.Errorf("edgex-asc:configure:validate: %q expects type %s, got %q", k, spec.Type, val)
+		}
+
+		touchedSections[confSection(k)] = true
+	}
+
+	for k, spec := range hooks.ConfToEnv {
+		if !spec.Required || !touchedSections[confSection(k)] {
+			continue
+		}
+		if _, ok := flatM[k]; !ok {
+			return fmt.Errorf("edgex-asc:configure:validate: required configuration key %q is missing", k)
+		}
+	}
+
+	return nil
+}
+
+// printSchema prints every recognized configuration key and its expected
+// type, one per line, for use by shell completion.
+func printSchema() {
+	keys := make([]string, 0, len(hooks.ConfToEnv))
+	for k := range hooks.ConfToEnv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
-	err := json.Unmarshal([]byte(env), &m)
+	for _, k := range keys {
+		fmt.Printf("%s\t%s\n", k, hooks.ConfToEnv[k].Type)
+	}
+}
+
+// backupServiceEnv copies the existing service.env aside to path+".bak" so
+// a failed health check can be rolled back to it. It is not an error for
+// there to be nothing to back up yet (first-ever configure).
+func backupServiceEnv(path string) error {
+	if !FileExists(path) {
+		return nil
+	}
+
+	contents, err := os.ReadFile(path)
 	if err != nil {
-		log.Err(fmt.Sprintf("edgex-asc:configure:handleSvcConf: failed to unmarshall env; %v", err))
+		return err
+	}
+
+	return os.WriteFile(path+".bak", contents, 0644)
+}
+
+// rollbackServiceEnv restores service.env from its .bak copy, if any.
+func rollbackServiceEnv(path string) {
+	bak := path + ".bak"
+	if !FileExists(bak) {
+		log.Err(fmt.Sprintf("edgex-asc:configure:rollback: no backup at %s, leaving %s as-is", bak, path))
 		return
 	}
 
+	if err := os.Rename(bak, path); err != nil {
+		log.Err(fmt.Sprintf("edgex-asc:configure:rollback: failed to restore %s from %s - %v", path, bak, err))
+	}
+}
+
+// handleSvcConf flattens env (in the given format) and writes it out as
+// service.env. It returns the Service.Host/Service.Port that were written,
+// if any, along with the flattened key/value pairs, so the caller can run
+// a post-configure health check against the restarted service.
+func handleSvcConf(env string, format string) (host string, port int, written map[string]string, err error) {
+	log.Info(fmt.Sprintf("edgex-asc:configure:handleSvcConf config is %s, format is %s", env, format))
+
+	if env == "" {
+		return "", 0, nil, nil
+	}
+
+	flatM := make(map[string]interface{})
+
+	m, err := unmarshalEnv(env, format)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("edgex-asc:configure:handleSvcConf: failed to unmarshal env as %s; %v", format, err)
+	}
+
 	for k, v := range m {
 		handleVal("", k, v, flatM)
 	}
 
+	if err := validateFlatM(flatM); err != nil {
+		return "", 0, nil, err
+	}
+
 	path := fmt.Sprintf("%s/config/res/service.env", snapData)
 
+	if err := backupServiceEnv(path); err != nil {
+		return "", 0, nil, fmt.Errorf("edgex-asc:configure:handleSvcConf: can't back up %s - %v", path, err)
+	}
+
 	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		log.Err(fmt.Sprintf("edgex-asc:configure:handleSvcConf: can't open %s - %v", path, err))
-		os.Exit(1)
+		return "", 0, nil, fmt.Errorf("edgex-asc:configure:handleSvcConf: can't open %s - %v", path, err)
 	}
 
 	defer f.Close()
 
 	log.Info(fmt.Sprintf("edgex-asc:configure:handleSvcConf about write %s", path))
+	written = make(map[string]string, len(flatM))
 	for k, v := range flatM {
+		val := fmt.Sprintf("%v", v)
 		log.Info(fmt.Sprintf("%s=%v", k, v))
-		_, err := f.WriteString(fmt.Sprintf("export %s=%s\n", hooks.ConfToEnv[k], v))
+		if _, err := f.WriteString(fmt.Sprintf("export %s=%s\n", hooks.ConfToEnv[k].EnvVar, val)); err != nil {
+			return "", 0, nil, fmt.Errorf("edgex-asc:configure:handleSvcConf: can't write %s - %v", path, err)
+		}
+		written[k] = val
+
+		if k == "Service.Host" {
+			host = val
+		}
+		if k == "Service.Port" {
+			if p, convErr := strconv.Atoi(val); convErr == nil {
+				port = p
+			}
+		}
+	}
+
+	return host, port, written, nil
+}
+
+// deriveServiceKey returns the EdgeX service key for the currently
+// installed profile, matching the instance naming convention used by
+// app-service-configurable's snapcraft.yaml apps stanza.
+func deriveServiceKey(prof string) string {
+	if prof == "" || prof == "default" {
+		return "app-service-configurable"
+	}
+	return fmt.Sprintf("app-service-configurable-%s", prof)
+}
+
+// registryKey builds the Consul KV path a flattened configuration key is
+// pushed under, matching go-mod-bootstrap's registry layout.
+func registryKey(serviceKey string, flatKey string) string {
+	return fmt.Sprintf("edgex/appservices/2.0/%s/%s", serviceKey, strings.ReplaceAll(flatKey, ".", "/"))
+}
+
+// pushToRegistry writes each flattened key/value to Consul under the
+// standard go-mod-bootstrap registry layout so a running service picks up
+// the change via its existing watch-on-config mechanism without a
+// restart. Consul being unreachable is not fatal; callers should log and
+// fall back to the file written by handleSvcConf.
+//
+// Map iteration order is random, so a write failing partway through the
+// loop would otherwise leave Consul holding a mix of old and new keys. A
+// cheap read up front catches a wholly unreachable Consul before any
+// writes happen; if a read or write still fails mid-loop (a bad token on
+// one key, a transient blip), every key already pushed this call is
+// restored to its prior value. The restoring writes are not checked, so a
+// Consul that also fails those keeps the keys pushed so far.
+func (c *Client) pushToRegistry(serviceKey string, written map[string]string) error {
+	host := "localhost"
+	port := 8500
+	var token string
+
+	c.snapGetStr("registry.host", &host)
+	c.snapGetInt("registry.port", &port)
+	c.snapGetStr("registry.token", &token)
+
+	cfg := consulapi.DefaultConfig()
+	cfg.Address = fmt.Sprintf("%s:%d", host, port)
+	if token != "" {
+		cfg.Token = token
+	}
+
+	consul, err := consulapi.NewClient(cfg)
+	if err != nil {
+		return fmt.Errorf("edgex-asc:configure:registry: can't create consul client - %v", err)
+	}
+
+	kv := consul.KV()
+
+	if _, _, err := kv.Get(fmt.Sprintf("edgex/appservices/2.0/%s", serviceKey), nil); err != nil {
+		return fmt.Errorf("edgex-asc:configure:registry: consul unreachable at %s - %v", cfg.Address, err)
+	}
+
+	prior := make(map[string]*consulapi.KVPair, len(written))
+	restore := func() {
+		for restoreKey, restorePair := range prior {
+			if restorePair == nil {
+				kv.Delete(restoreKey, nil)
+			} else {
+				kv.Put(restorePair, nil)
+			}
+		}
+	}
+
+	for k, v := range written {
+		key := registryKey(serviceKey, k)
+
+		prev, _, err := kv.Get(key, nil)
+		if err != nil {
+			restore()
+			return fmt.Errorf("edgex-asc:configure:registry: can't read prior value of %s - %v", key, err)
+		}
+
+		if _, err := kv.Put(&consulapi.KVPair{Key: key, Value: []byte(v)}, nil); err != nil {
+			restore()
+			return fmt.Errorf("edgex-asc:configure:registry: can't push %s - %v", key, err)
+		}
+
+		prior[key] = prev
+	}
+
+	return nil
+}
+
+// restartService restarts the app service via snapctl so the freshly
+// written service.env takes effect.
+func restartService() error {
+	return exec.Command("snapctl", "restart", os.Getenv("SNAP_INSTANCE_NAME")).Run()
+}
+
+// pingService polls the EdgeX v2 ping endpoint until it responds OK or the
+// retries are exhausted.
+func pingService(host string, port int) error {
+	url := fmt.Sprintf("http://%s:%d/api/v2/ping", host, port)
+
+	var lastErr error
+	for i := 0; i < healthCheckRetries; i++ {
+		time.Sleep(healthCheckDelay)
+
+		resp, err := http.Get(url)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			return nil
+		}
+		lastErr = fmt.Errorf("ping returned status %d", resp.StatusCode)
+	}
+
+	return fmt.Errorf("edgex-asc:configure:healthcheck: service never answered %s - %v", url, lastErr)
+}
+
+// fetchConfig fetches and flattens the running service's v2 config.
+func fetchConfig(host string, port int) (map[string]interface{}, error) {
+	url := fmt.Sprintf("http://%s:%d/api/v2/config", host, port)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch %s - %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	var cfgResp struct {
+		Config map[string]interface{} `json:"config"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cfgResp); err != nil {
+		return nil, fmt.Errorf("couldn't decode %s - %v", url, err)
+	}
+
+	liveFlat := make(map[string]interface{})
+	for k, v := range cfgResp.Config {
+		handleVal("", k, v, liveFlat)
+	}
+
+	return liveFlat, nil
+}
+
+// configMatches reports whether every key in written is present in
+// liveFlat with the same value.
+func configMatches(liveFlat map[string]interface{}, written map[string]string) error {
+	for k, wantVal := range written {
+		gotVal, ok := liveFlat[k]
+		if !ok {
+			return fmt.Errorf("key %s missing from running config", k)
+		}
+		if fmt.Sprintf("%v", gotVal) != wantVal {
+			return fmt.Errorf("key %s is %v, expected %s", k, gotVal, wantVal)
+		}
+	}
+	return nil
+}
+
+// verifyConfig polls the running service's v2 config until the keys just
+// written to service.env show up in it, or the retries are exhausted. A
+// single un-retried fetch right after pingService succeeds would risk a
+// spurious rollback: the service can answer /ping before it's finished
+// reloading its config.
+func verifyConfig(host string, port int, written map[string]string) error {
+	var lastErr error
+	for i := 0; i < healthCheckRetries; i++ {
+		time.Sleep(healthCheckDelay)
+
+		liveFlat, err := fetchConfig(host, port)
 		if err != nil {
-			log.Err(fmt.Sprintf("edgex-asc:configure:handleSvcConf: can't open %s - %v", path, err))
-			os.Exit(1)
+			lastErr = err
+			continue
+		}
+
+		if err := configMatches(liveFlat, written); err != nil {
+			lastErr = err
+			continue
 		}
+
+		return nil
 	}
+
+	return fmt.Errorf("edgex-asc:configure:healthcheck: config never matched - %v", lastErr)
 }
 
 func handleProf(prof string) {
@@ -215,7 +615,12 @@ func handleProf(prof string) {
 }
 
 func main() {
-	var env, prof string
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		printSchema()
+		return
+	}
+
+	var env, prof, format string
 
 	log, err := syslog.New(syslog.LOG_INFO, "edgex-asc:configure")
 	if err != nil {
@@ -238,6 +643,62 @@ func main() {
 	client.snapGetStr("profile", &prof)
 	handleProf(prof)
 
+	format = "json"
+	client.snapGetStr("format", &format)
+
 	client.snapGetStr("env", &env)
-	handleSvcConf(env)
+	host, port, written, err := handleSvcConf(env, format)
+	if err != nil {
+		log.Err(err.Error())
+		os.Exit(1)
+	}
+
+	var registry string
+	client.snapGetStr("registry", &registry)
+	pushedToRegistry := false
+	if registry == "consul" {
+		if err := client.pushToRegistry(deriveServiceKey(prof), written); err != nil {
+			log.Warning(fmt.Sprintf("%v, falling back to file-only mode", err))
+		} else {
+			pushedToRegistry = true
+		}
+	}
+
+	if pushedToRegistry {
+		// the running service picks up the new config via its own
+		// watch-on-config against the registry; restarting it here would
+		// defeat the point of push-through mode.
+		return
+	}
+
+	if host == "" || port == 0 {
+		// nothing was written, or no Service.Host/Service.Port were set -
+		// there's no endpoint to verify against.
+		return
+	}
+
+	path := fmt.Sprintf("%s/config/res/service.env", snapData)
+
+	if err := restartService(); err != nil {
+		log.Err(fmt.Sprintf("edgex-asc:configure:healthcheck: restart failed - %v", err))
+		rollbackServiceEnv(path)
+		restartService()
+		os.Exit(1)
+	}
+
+	if err := pingService(host, port); err != nil {
+		log.Err(err.Error())
+		rollbackServiceEnv(path)
+		restartService()
+		os.Exit(1)
+	}
+
+	if err := verifyConfig(host, port, written); err != nil {
+		log.Err(err.Error())
+		rollbackServiceEnv(path)
+		restartService()
+		os.Exit(1)
+	}
+
+	log.Info("edgex-asc:configure:healthcheck: new config verified against running service")
 }
@@ -0,0 +1,41 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import "testing"
+
+// pushToRegistry itself talks to a real Consul agent, so it isn't covered
+// here; this exercises the pure key-naming logic it builds on.
+func TestDeriveServiceKey(t *testing.T) {
+	cases := []struct {
+		prof string
+		want string
+	}{
+		{"", "app-service-configurable"},
+		{"default", "app-service-configurable"},
+		{"rules-engine", "app-service-configurable-rules-engine"},
+	}
+
+	for _, c := range cases {
+		if got := deriveServiceKey(c.prof); got != c.want {
+			t.Errorf("deriveServiceKey(%q) = %q, want %q", c.prof, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupAndRollbackServiceEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.env")
+
+	if err := os.WriteFile(path, []byte("export FOO=bar\n"), 0644); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	if err := backupServiceEnv(path); err != nil {
+		t.Fatalf("backupServiceEnv: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("export FOO=baz\n"), 0644); err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+
+	rollbackServiceEnv(path)
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading rolled-back file: %v", err)
+	}
+	if string(got) != "export FOO=bar\n" {
+		t.Errorf("got %q, want %q", got, "export FOO=bar\n")
+	}
+}
+
+func TestBackupServiceEnvNoExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.env")
+
+	if err := backupServiceEnv(path); err != nil {
+		t.Fatalf("backupServiceEnv with no existing file: %v", err)
+	}
+}
+
+func TestRollbackServiceEnvNoBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.env")
+
+	if err := os.WriteFile(path, []byte("export FOO=bar\n"), 0644); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	rollbackServiceEnv(path)
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading file: %v", err)
+	}
+	if string(got) != "export FOO=bar\n" {
+		t.Errorf("rollback with no backup should leave the file untouched, got %q", got)
+	}
+}
@@ -0,0 +1,101 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import "testing"
+
+func TestCheckType(t *testing.T) {
+	cases := []struct {
+		val, typ string
+		want     bool
+	}{
+		{"8080", "int", true},
+		{"not-a-number", "int", false},
+		{"true", "bool", true},
+		{"maybe", "bool", false},
+		{"1.5", "float", true},
+		{"10s", "duration", true},
+		{"nope", "duration", false},
+		{"anything", "string", true},
+		{"a,b,c", "[]string", true},
+	}
+
+	for _, c := range cases {
+		if got := checkType(c.val, c.typ); got != c.want {
+			t.Errorf("checkType(%q, %q) = %v, want %v", c.val, c.typ, got, c.want)
+		}
+	}
+}
+
+func TestValidateFlatMRejectsUnknownKey(t *testing.T) {
+	flatM := map[string]interface{}{
+		"Service.Host": "localhost",
+		"Service.Port": "8080",
+		"Bogus.Key":    "x",
+	}
+
+	if err := validateFlatM(flatM); err == nil {
+		t.Fatal("expected an error for an unrecognized key")
+	}
+}
+
+func TestValidateFlatMRejectsBadType(t *testing.T) {
+	flatM := map[string]interface{}{
+		"Service.Host": "localhost",
+		"Service.Port": "not-a-port",
+	}
+
+	if err := validateFlatM(flatM); err == nil {
+		t.Fatal("expected an error for a malformed int")
+	}
+}
+
+func TestValidateFlatMSkipsRequiredForUntouchedSection(t *testing.T) {
+	// a snap set that only pastes a [Writable] block shouldn't be forced
+	// to also repeat Service.Host/Service.Port.
+	flatM := map[string]interface{}{
+		"Writable.LogLevel": "INFO",
+	}
+
+	if err := validateFlatM(flatM); err != nil {
+		t.Errorf("unexpected error for a config that never touches Service: %v", err)
+	}
+}
+
+func TestValidateFlatMRequiresServiceHostAndPort(t *testing.T) {
+	flatM := map[string]interface{}{
+		"Service.Host": "localhost",
+	}
+
+	if err := validateFlatM(flatM); err == nil {
+		t.Fatal("expected an error for a Service section missing Service.Port")
+	}
+}
+
+func TestValidateFlatMAccepts(t *testing.T) {
+	flatM := map[string]interface{}{
+		"Service.Host": "localhost",
+		"Service.Port": "8080",
+	}
+
+	if err := validateFlatM(flatM); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2017 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package hooks
+
+// ConfSpec describes how a single flattened "Section.Key" configuration
+// path maps onto the running service: the environment variable it is
+// exported as, and the JSON type snap set values for it are validated
+// against (one of "string", "bool", "int", "float", "duration",
+// "[]string").
+type ConfSpec struct {
+	EnvVar   string
+	Type     string
+	Required bool
+}
+
+// ConfToEnv maps every flattened configuration key the edgex-asc "env"
+// snap option accepts to its ConfSpec. Keys not present here are rejected
+// by handleSvcConf before service.env is ever touched.
+var ConfToEnv = map[string]ConfSpec{
+	"Service.Host":             {EnvVar: "SERVICE_HOST", Type: "string", Required: true},
+	"Service.Port":             {EnvVar: "SERVICE_PORT", Type: "int", Required: true},
+	"Service.StartupMsg":       {EnvVar: "SERVICE_STARTUPMSG", Type: "string"},
+	"Service.Timeout":          {EnvVar: "SERVICE_TIMEOUT", Type: "duration"},
+	"Writable.LogLevel":        {EnvVar: "WRITABLE_LOGLEVEL", Type: "string"},
+	"Writable.InsecureSecrets": {EnvVar: "WRITABLE_INSECURESECRETS", Type: "[]string"},
+	"MessageBus.Host":          {EnvVar: "MESSAGEBUS_HOST", Type: "string"},
+	"MessageBus.Port":          {EnvVar: "MESSAGEBUS_PORT", Type: "int"},
+	"Clients.Data.Host":        {EnvVar: "CLIENTS_DATA_HOST", Type: "string"},
+	"Clients.Data.Port":        {EnvVar: "CLIENTS_DATA_PORT", Type: "int"},
+	"Binding.Type":             {EnvVar: "BINDING_TYPE", Type: "string"},
+	"Binding.SubscribeTopic":   {EnvVar: "BINDING_SUBSCRIBETOPIC", Type: "string"},
+	"Binding.PublishTopic":     {EnvVar: "BINDING_PUBLISHTOPIC", Type: "string"},
+}